@@ -0,0 +1,210 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/otto/app"
+)
+
+// catalogFileName is the name of the file, stored under CatalogDir, that
+// tracks the set of registered external plugin versions.
+const catalogFileName = "plugins.json"
+
+// catalogEntry is a single registered plugin within the catalog file.
+type catalogEntry struct {
+	Path    string      `json:"path"`
+	Version string      `json:"version"`
+	Tuples  []app.Tuple `json:"tuples"`
+
+	// Ref is the registry ref this entry was installed from, if it was
+	// installed via PluginManager.Install rather than Register. It lets
+	// a digest-ref entry be re-pulled by Discover/Load on a machine whose
+	// blobstore doesn't already have it.
+	Ref string `json:"ref,omitempty"`
+}
+
+// catalogFile is the on-disk format of the catalog.
+type catalogFile struct {
+	Entries []catalogEntry `json:"entries"`
+}
+
+// catalogPath returns the path to the catalog file within CatalogDir.
+func (m *PluginManager) catalogPath() string {
+	return filepath.Join(m.CatalogDir, catalogFileName)
+}
+
+// readCatalog loads the catalog file, returning an empty catalog if it
+// doesn't exist yet or if CatalogDir isn't set.
+func (m *PluginManager) readCatalog() (*catalogFile, error) {
+	if m.CatalogDir == "" {
+		return &catalogFile{}, nil
+	}
+
+	data, err := ioutil.ReadFile(m.catalogPath())
+	if os.IsNotExist(err) {
+		return &catalogFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var c catalogFile
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("Error parsing plugin catalog: %s", err)
+	}
+
+	return &c, nil
+}
+
+// writeCatalog persists the catalog via a tempfile-and-rename so that a
+// crash or concurrent read never observes a half-written catalog.
+func (m *PluginManager) writeCatalog(c *catalogFile) error {
+	if m.CatalogDir == "" {
+		return fmt.Errorf("CatalogDir must be set to modify the plugin catalog")
+	}
+
+	if err := os.MkdirAll(m.CatalogDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tf, err := ioutil.TempFile(m.CatalogDir, catalogFileName)
+	if err != nil {
+		return err
+	}
+	tmpPath := tf.Name()
+
+	if _, err := tf.Write(data); err != nil {
+		tf.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, m.catalogPath())
+}
+
+// Register adds the plugin binary at path, at the given version, to the
+// plugin catalog so that future calls to Discover will consider it. The
+// binary is loaded once to determine the app tuples it provides.
+//
+// Register is for a local binary the caller already trusts enough to
+// execute directly; Install, which registers a binary pulled from a
+// registry, deliberately does not go through here, since running an
+// unverified download just to learn its tuples would defeat the
+// privilege-prompt and signature-check gates entirely.
+func (m *PluginManager) Register(path, version string) error {
+	p := &Plugin{Path: path}
+	if err := p.Load(); err != nil {
+		return fmt.Errorf("Error registering plugin %s: %s", path, err)
+	}
+
+	if version == "" {
+		version = p.Version
+	}
+
+	return m.upsertCatalogEntry(catalogEntry{
+		Path:    path,
+		Version: version,
+		Tuples:  p.AppMeta.Tuples,
+	})
+}
+
+// upsertCatalogEntry adds entry to the catalog, replacing any existing
+// entry for the same (Path, Version).
+func (m *PluginManager) upsertCatalogEntry(entry catalogEntry) error {
+	m.catalogMu.Lock()
+	defer m.catalogMu.Unlock()
+
+	c, err := m.readCatalog()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i, e := range c.Entries {
+		if e.Path == entry.Path && e.Version == entry.Version {
+			c.Entries[i] = entry
+			found = true
+			break
+		}
+	}
+	if !found {
+		c.Entries = append(c.Entries, entry)
+	}
+
+	return m.writeCatalog(c)
+}
+
+// Deregister removes the catalog entry for the app type "name" at the
+// given version. It is not an error to deregister an entry that doesn't
+// provide that app type; only matching entries are removed, each one
+// whole, including any other app types it also provides.
+func (m *PluginManager) Deregister(name, version string) error {
+	m.catalogMu.Lock()
+	defer m.catalogMu.Unlock()
+
+	c, err := m.readCatalog()
+	if err != nil {
+		return err
+	}
+
+	kept := c.Entries[:0]
+	for _, e := range c.Entries {
+		if e.Version == version && entryProvidesType(e, name) {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	c.Entries = kept
+
+	return m.writeCatalog(c)
+}
+
+// List returns the catalog-registered plugins that provide the given app
+// type, across all registered versions.
+func (m *PluginManager) List(name string) ([]*Plugin, error) {
+	m.catalogMu.RLock()
+	defer m.catalogMu.RUnlock()
+
+	c, err := m.readCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Plugin
+	for _, e := range c.Entries {
+		if !entryProvidesType(e, name) {
+			continue
+		}
+
+		result = append(result, &Plugin{
+			Path:    e.Path,
+			Version: e.Version,
+			Ref:     e.Ref,
+		})
+	}
+
+	return result, nil
+}
+
+func entryProvidesType(e catalogEntry, name string) bool {
+	for _, t := range e.Tuples {
+		if t.Type == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/otto/app"
+)
+
+func TestCatalogWriteReadRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otto-catalog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &PluginManager{CatalogDir: dir}
+
+	c := &catalogFile{
+		Entries: []catalogEntry{
+			{Path: "/bin/otto-aws", Version: "1.0.0"},
+			{Path: "sha256:deadbeef", Version: "2.0.0", Ref: "registry.otto.sh/hashicorp/aws:2.0.0"},
+		},
+	}
+
+	if err := m.writeCatalog(c); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	got, err := m.readCatalog()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(got.Entries) != len(c.Entries) {
+		t.Fatalf("expected %d entries, got %d", len(c.Entries), len(got.Entries))
+	}
+	if got.Entries[1].Ref != c.Entries[1].Ref {
+		t.Fatalf("expected Ref to round-trip, got %q", got.Entries[1].Ref)
+	}
+
+	// writeCatalog must not leave any tempfile debris behind alongside
+	// the real catalog file.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(files) != 1 || files[0].Name() != catalogFileName {
+		t.Fatalf("expected only %s in %s, found %v", catalogFileName, dir, files)
+	}
+}
+
+func TestReadCatalogMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otto-catalog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &PluginManager{CatalogDir: dir}
+
+	c, err := m.readCatalog()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(c.Entries) != 0 {
+		t.Fatalf("expected an empty catalog, got %d entries", len(c.Entries))
+	}
+}
+
+func TestReadCatalogNoCatalogDir(t *testing.T) {
+	m := &PluginManager{}
+
+	c, err := m.readCatalog()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(c.Entries) != 0 {
+		t.Fatalf("expected an empty catalog, got %d entries", len(c.Entries))
+	}
+}
+
+func TestWriteCatalogNoCatalogDir(t *testing.T) {
+	m := &PluginManager{}
+
+	if err := m.writeCatalog(&catalogFile{}); err == nil {
+		t.Fatal("expected an error writing a catalog with no CatalogDir set")
+	}
+}
+
+func TestEntryProvidesType(t *testing.T) {
+	matching := catalogEntry{Tuples: []app.Tuple{{Type: "aws"}}}
+	if !entryProvidesType(matching, "aws") {
+		t.Fatal("expected entry to provide aws")
+	}
+	if entryProvidesType(matching, "vagrant") {
+		t.Fatal("expected entry not to provide vagrant")
+	}
+}
@@ -0,0 +1,160 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/hashicorp/otto/app"
+	"github.com/hashicorp/otto/command/pluginstore"
+)
+
+// Install pulls the plugin identified by ref (e.g.
+// "registry.otto.sh/hashicorp/aws:1.2.0") from resolver into the local
+// blobstore and registers it in the catalog as a digest-ref entry, so
+// that future calls to Discover will consider it. This is the
+// implementation behind `otto plugin install`.
+//
+// The binary itself is never executed here: its Tuples and declared
+// Privileges come entirely from manifest.Config, the inspectable blob
+// Push uploads for exactly this purpose. Running a just-downloaded,
+// unverified binary to learn the same thing would hand it a free pass
+// around the privilege prompt and signature check that are supposed to
+// gate it before Load ever runs.
+func (m *PluginManager) Install(ref string, resolver pluginstore.Resolver) (*Plugin, error) {
+	parsed, err := pluginstore.ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := resolver.Manifest(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching manifest for %s: %s", ref, err)
+	}
+	if len(manifest.Layers) == 0 {
+		return nil, fmt.Errorf("manifest for %s has no layers", ref)
+	}
+
+	config, err := fetchPluginConfig(parsed, manifest.Config, resolver)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching config for %s: %s", ref, err)
+	}
+
+	blobstore, err := defaultBlobstore()
+	if err != nil {
+		return nil, fmt.Errorf("Error locating plugin blobstore: %s", err)
+	}
+
+	// The binary is always the first (and today, only) layer.
+	digest := manifest.Layers[0]
+	if !blobstore.Has(digest) {
+		rc, err := resolver.Blob(parsed, digest)
+		if err != nil {
+			return nil, fmt.Errorf("Error pulling plugin blob %s: %s", digest, err)
+		}
+
+		got, err := blobstore.Put(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Error storing plugin blob %s: %s", digest, err)
+		}
+		if got != digest {
+			return nil, fmt.Errorf("plugin blob %s from %s has unexpected digest %s", digest, ref, got)
+		}
+	}
+
+	path := digest.String()
+	if err := m.upsertCatalogEntry(catalogEntry{
+		Path:    path,
+		Version: manifest.Version,
+		Tuples:  config.Tuples,
+		Ref:     ref,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &Plugin{
+		Path:     path,
+		Version:  manifest.Version,
+		Ref:      ref,
+		AppMeta:  &app.Meta{Tuples: config.Tuples, Version: manifest.Version, Privileges: config.Privileges},
+		Resolver: resolver,
+	}, nil
+}
+
+// fetchPluginConfig fetches and decodes the PluginConfig blob at digest,
+// the manifest's inspectable metadata about a plugin's tuples and
+// declared privileges.
+func fetchPluginConfig(ref pluginstore.Ref, digest pluginstore.Digest, resolver pluginstore.Resolver) (*pluginstore.PluginConfig, error) {
+	rc, err := resolver.Blob(ref, digest)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	var config pluginstore.PluginConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("Error parsing plugin config: %s", err)
+	}
+
+	return &config, nil
+}
+
+// Push loads p (if it hasn't been already), uploads its binary and
+// declared metadata to resolver, and publishes a manifest for ref (e.g.
+// "registry.otto.sh/hashicorp/aws:1.2.0"). This is the implementation
+// behind `otto plugin push`.
+func (m *PluginManager) Push(p *Plugin, ref string, resolver pluginstore.Resolver) error {
+	if p.AppMeta == nil {
+		if err := p.Load(); err != nil {
+			return fmt.Errorf("Error loading plugin %s: %s", p.Path, err)
+		}
+	}
+
+	parsed, err := pluginstore.ParseRef(ref)
+	if err != nil {
+		return err
+	}
+
+	bin, err := os.Open(p.Path)
+	if err != nil {
+		return err
+	}
+	layerDigest, err := resolver.PushBlob(parsed, bin)
+	bin.Close()
+	if err != nil {
+		return fmt.Errorf("Error pushing plugin binary for %s: %s", ref, err)
+	}
+
+	configData, err := json.Marshal(&pluginstore.PluginConfig{
+		Tuples:     p.AppMeta.Tuples,
+		Privileges: p.AppMeta.Privileges,
+	})
+	if err != nil {
+		return err
+	}
+
+	configDigest, err := resolver.PushBlob(parsed, bytes.NewReader(configData))
+	if err != nil {
+		return fmt.Errorf("Error pushing plugin config for %s: %s", ref, err)
+	}
+
+	manifest := &pluginstore.PluginManifest{
+		MediaType: pluginstore.ManifestMediaType,
+		Config:    configDigest,
+		Layers:    []pluginstore.Digest{layerDigest},
+		Version:   p.Version,
+	}
+	if err := resolver.PushManifest(parsed, manifest); err != nil {
+		return fmt.Errorf("Error pushing plugin manifest for %s: %s", ref, err)
+	}
+
+	return nil
+}
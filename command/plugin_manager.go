@@ -1,28 +1,44 @@
 package command
 
 import (
+	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-version"
 	"github.com/hashicorp/otto/app"
+	"github.com/hashicorp/otto/command/pluginstore"
 	"github.com/hashicorp/otto/helper/semaphore"
 	"github.com/hashicorp/otto/otto"
 	"github.com/hashicorp/otto/plugin"
 	"github.com/kardianos/osext"
+	"github.com/mitchellh/go-homedir"
 )
 
 // PluginGlob is the glob pattern used to find plugins.
 const PluginGlob = "otto-*"
 
+// BuiltinPluginVersion is the version recorded for plugins that are
+// compiled into the Otto binary itself rather than discovered as an
+// external, versioned artifact. It always loses to any real semantic
+// version when `ConfigureCore` is selecting between multiple sources
+// for the same app tuple.
+const BuiltinPluginVersion = "builtin"
+
 // PluginManager is responsible for discovering and starting plugins.
 //
 // Plugin cleanup is done out in the main package: we just defer
@@ -36,7 +52,45 @@ type PluginManager struct {
 	// PluginMap is the map of availabile built-in plugins
 	PluginMap plugin.ServeMuxMap
 
-	plugins []*Plugin
+	// CatalogDir is the Otto working directory under which the plugin
+	// catalog (external plugins registered via `Register`) is persisted.
+	// If empty, List returns no plugins, Register and Deregister return an
+	// error, and Discover only finds builtins and PluginDirs.
+	CatalogDir string
+
+	// PinnedVersions pins a specific plugin version for an app tuple,
+	// typically populated from an `app { version = "..." }` directive in
+	// the Otterfile. When unset for a tuple, ConfigureCore selects the
+	// highest semantic version available.
+	PinnedVersions map[app.Tuple]string
+
+	// AppSelector, when set, is consulted by ConfigureCore whenever more
+	// than one plugin source ties for the highest version of the same
+	// app tuple (a collision PinnedVersions doesn't resolve) so the user
+	// can deterministically pick a winner instead of ConfigureCore
+	// failing.
+	AppSelector func(tuple app.Tuple, candidates []*Plugin) (*Plugin, error)
+
+	// GrantAllPermissions corresponds to the `--grant-all-permissions`
+	// flag: when true, EnsurePrivileges grants every privilege a plugin
+	// requests without prompting.
+	GrantAllPermissions bool
+
+	// PrivilegePrompt, if set, is used by EnsurePrivileges to ask the
+	// user whether to grant a plugin's requested privileges. If nil, a
+	// default stdin/stdout y/N prompt is used.
+	PrivilegePrompt func(message string) (bool, error)
+
+	// Resolver, if set, is used to pull a digest-ref plugin's blob on
+	// demand for any plugin that doesn't already have its own Resolver
+	// set. Install and Push don't use it; they take their resolver as an
+	// argument. Discover and LoadUsed propagate this to
+	// every restored plugin so that a used-plugins file produced on one
+	// machine can be loaded on another with an empty blobstore.
+	Resolver pluginstore.Resolver
+
+	catalogMu sync.RWMutex
+	plugins   []*Plugin
 }
 
 // Plugin is a single plugin that has been loaded.
@@ -55,12 +109,56 @@ type Plugin struct {
 	// for now we stick to things built-in to the Go stdlib.
 	MD5 string `json:"md5"`
 
+	// Version is the semantic version of this plugin, as reported by its
+	// AppMeta. It is populated during Load. Plugins that don't report a
+	// version (builtins) get BuiltinPluginVersion instead, so that they
+	// always lose to a real version when ConfigureCore is choosing between
+	// multiple sources for the same app tuple.
+	Version string `json:"version"`
+
+	// Digest is the sha256 content digest of Path, set by CalcDigest.
+	// Unlike MD5, Digest is cryptographic, which is what lets
+	// command/pluginstore address a plugin by its content: Path can be
+	// set to a "sha256:<digest>" reference instead of a filesystem path,
+	// and Load will materialize the binary from the local blobstore
+	// before executing it.
+	Digest string `json:"digest,omitempty"`
+
+	// GrantedPrivileges is the set of Privilege kinds the user has
+	// approved for this plugin, set by PluginManager.EnsurePrivileges.
+	// It's persisted by StoreUsed so that later runs don't re-prompt
+	// unless the plugin's digest or requested privileges change.
+	GrantedPrivileges []string `json:"granted_privileges,omitempty"`
+
+	// GrantedDigest is the content digest (see CalcDigest) of the binary
+	// that GrantedPrivileges was granted against, set alongside it by
+	// EnsurePrivileges. A binary swapped in at the same Path that still
+	// declares the same privilege kinds must not silently inherit a
+	// prior grant, so EnsurePrivileges re-prompts whenever the current
+	// digest no longer matches this one.
+	GrantedDigest string `json:"granted_digest,omitempty"`
+
+	// Ref is the registry ref (e.g.
+	// "registry.otto.sh/hashicorp/aws:1.2.0") this plugin was installed
+	// from, if any. It's persisted by StoreUsed so that LoadUsed on a
+	// different machine, whose blobstore doesn't already have Path's
+	// blob, knows where to pull it from via Resolver.
+	Ref string `json:"ref,omitempty"`
+
+	// Resolver, if set, is used to pull Path's blob from a registry when
+	// Path is a digest reference not already present in the local
+	// blobstore. It is not persisted; callers repopulating a PluginManager
+	// from a used-plugins file (see LoadUsed) should set PluginManager.Resolver
+	// instead, which LoadUsed propagates to each plugin automatically.
+	Resolver pluginstore.Resolver `json:"-"`
+
 	// The fields below are loaded as part of the Load() call and should
 	// not be set manually, but can be accessed after Load.
 	App     app.Factory `json:"-"`
 	AppMeta *app.Meta   `json:"-"`
 
-	used bool
+	used              bool
+	privilegesGranted bool
 }
 
 // CalcMD5 calculates the MD5 hash of this plugin and saves it to MD5.
@@ -81,12 +179,43 @@ func (p *Plugin) CalcMD5() error {
 	return nil
 }
 
+// digestRefPrefix marks a Plugin.Path as a content-addressable reference
+// into the local blobstore rather than a filesystem path, e.g.
+// "sha256:abc123...".
+const digestRefPrefix = "sha256:"
+
+// CalcDigest calculates the sha256 content digest of this plugin and
+// saves it to Digest. This is the cryptographic counterpart to CalcMD5:
+// manifests published via command/pluginstore address content by sha256,
+// so that two machines resolving the same manifest pull the exact same
+// bits.
+func (p *Plugin) CalcDigest() error {
+	f, err := os.Open(p.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+
+	p.Digest = digestRefPrefix + hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
 // Load loads the plugin specified by the Path and instantiates the
 // other fields on this structure.
 func (p *Plugin) Load() error {
+	execPath, err := p.resolveExecPath()
+	if err != nil {
+		return err
+	}
+
 	// Create the plugin client to communicate with the process
 	pluginClient := plugin.NewClient(&plugin.ClientConfig{
-		Cmd:     exec.Command(p.Path, p.Args...),
+		Cmd:     exec.Command(execPath, p.Args...),
 		Managed: true,
 	})
 
@@ -110,16 +239,127 @@ func (p *Plugin) Load() error {
 		return err
 	}
 
-	// Create a custom factory that when called marks the plugin as used
+	p.Version = p.AppMeta.Version
+	if p.Version == "" {
+		p.Version = BuiltinPluginVersion
+	}
+
+	// Create a custom factory that when called marks the plugin as used.
+	// It refuses to actually hand back an App until EnsurePrivileges has
+	// run and approved whatever this plugin's AppMeta requests: a plugin
+	// whose privileges were declined must never be callable just because
+	// its Load error got bundled into a multierror a caller chose to log
+	// and continue past.
 	p.used = false
+	realApp := client.App
 	p.App = func() (app.App, error) {
+		if !p.privilegesGranted {
+			return nil, fmt.Errorf(
+				"plugin %s's privileges have not been granted; call "+
+					"PluginManager.EnsurePrivileges first", p.Path)
+		}
+
 		p.used = true
-		return client.App()
+		return realApp()
+	}
+
+	return nil
+}
+
+// resolveExecPath returns the path to actually exec for this plugin: Path
+// itself, unless it's a digest reference, in which case the referenced
+// blob is materialized into a per-run temp dir first.
+func (p *Plugin) resolveExecPath() (string, error) {
+	if !strings.HasPrefix(p.Path, digestRefPrefix) {
+		return p.Path, nil
+	}
+
+	blobstore, err := defaultBlobstore()
+	if err != nil {
+		return "", fmt.Errorf("Error locating plugin blobstore: %s", err)
+	}
+
+	digest := pluginstore.Digest(p.Path)
+	if !blobstore.Has(digest) {
+		if err := p.pullBlob(blobstore, digest); err != nil {
+			return "", err
+		}
+	}
+
+	src, err := blobstore.Get(digest)
+	if err != nil {
+		return "", fmt.Errorf("Error fetching plugin %s from blobstore: %s", p.Path, err)
+	}
+	defer src.Close()
+
+	dir, err := ioutil.TempDir("", "otto-plugin")
+	if err != nil {
+		return "", err
+	}
+
+	dstPath := filepath.Join(dir, filepath.Base(p.Path))
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY, 0755)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return "", fmt.Errorf("Error materializing plugin %s: %s", p.Path, err)
+	}
+
+	return dstPath, nil
+}
+
+// pullBlob fetches digest into blobstore from p.Resolver, so that a
+// digest-ref Plugin restored on a machine whose blobstore doesn't
+// already have the bits (for example, via LoadUsed after StoreUsed
+// recorded the manifest digest on a different machine) can still be
+// loaded instead of failing with a blobstore miss.
+func (p *Plugin) pullBlob(blobstore *pluginstore.Blobstore, digest pluginstore.Digest) error {
+	if p.Resolver == nil || p.Ref == "" {
+		return fmt.Errorf(
+			"plugin %s is not present in the local blobstore and no "+
+				"registry is configured to pull it from; run `otto plugin install`",
+			p.Path)
+	}
+
+	ref, err := pluginstore.ParseRef(p.Ref)
+	if err != nil {
+		return err
+	}
+
+	rc, err := p.Resolver.Blob(ref, digest)
+	if err != nil {
+		return fmt.Errorf("Error pulling plugin %s from %s: %s", p.Path, ref, err)
+	}
+	defer rc.Close()
+
+	got, err := blobstore.Put(rc)
+	if err != nil {
+		return fmt.Errorf("Error storing plugin %s pulled from %s: %s", p.Path, ref, err)
+	}
+	if got != digest {
+		return fmt.Errorf("plugin %s pulled from %s has unexpected digest %s", p.Path, ref, got)
 	}
 
 	return nil
 }
 
+// defaultBlobstore returns the Blobstore rooted at the user's Otto
+// working directory (~/.otto.d/plugins/blobs), used to resolve any
+// Plugin whose Path is a digest reference.
+func defaultBlobstore() (*pluginstore.Blobstore, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pluginstore.Blobstore{
+		Dir: filepath.Join(home, ".otto.d", "plugins", "blobs"),
+	}, nil
+}
+
 // Used tracks whether or not this plugin was used or not. You can call
 // this after compilation on each plugin to determine what plugin
 // was used.
@@ -131,20 +371,193 @@ func (p *Plugin) String() string {
 	return fmt.Sprintf("%s %v", p.Path, p.Args)
 }
 
+// QualifiedTuple namespaces an app.Tuple by the Source of the plugin
+// claiming it, the same way the Go linker prefixes exported `plugin`
+// package symbols with their full import path. Two plugins are free to
+// both claim the same Tuple as long as they're tracked under distinct
+// (Tuple, Source) keys; it's only when ConfigureCore has to collapse
+// those candidates down to the single app.Factory that core.Apps can
+// hold that a collision becomes an error.
+type QualifiedTuple struct {
+	Tuple  app.Tuple
+	Source string
+}
+
+// Source returns the canonical name used to qualify p's claim to any
+// app.Tuple it implements: its registry ref if it was installed from a
+// registry via command/pluginstore, and otherwise its path and version.
+func (p *Plugin) Source() string {
+	if p.Ref != "" {
+		return p.Ref
+	}
+
+	return fmt.Sprintf("%s@%s", p.Path, p.Version)
+}
+
 // ConfigureCore configures the Otto core configuration with the loaded
 // plugin data.
+//
+// When multiple loaded plugins declare the same app tuple (because more
+// than one version of that app plugin was discovered), the version to use
+// is chosen by PinnedVersions if the tuple has a pin, and otherwise by
+// picking the highest semantic version. If more than one plugin source
+// ties at that version, that's a genuine collision: ConfigureCore
+// consults AppSelector if one is configured, and otherwise reports every
+// colliding source in the returned multierror.Error rather than letting
+// whichever plugin happened to be discovered last silently win.
 func (m *PluginManager) ConfigureCore(core *otto.CoreConfig) error {
 	if core.Apps == nil {
 		core.Apps = make(map[app.Tuple]app.Factory)
 	}
 
+	byTuple := make(map[app.Tuple][]*Plugin)
 	for _, p := range m.Plugins() {
 		for _, tuple := range p.AppMeta.Tuples {
-			core.Apps[tuple] = p.App
+			byTuple[tuple] = append(byTuple[tuple], p)
 		}
 	}
 
-	return nil
+	var result error
+	for tuple, plugins := range byTuple {
+		p, err := m.resolveTuple(tuple, plugins)
+		if err != nil {
+			result = multierror.Append(result, err)
+			continue
+		}
+
+		core.Apps[tuple] = p.App
+	}
+
+	return result
+}
+
+// resolveTuple chooses which of the candidate plugins (all of which
+// implement tuple) should be bound into the core configuration.
+func (m *PluginManager) resolveTuple(tuple app.Tuple, plugins []*Plugin) (*Plugin, error) {
+	if pin, ok := m.PinnedVersions[tuple]; ok {
+		for _, p := range plugins {
+			if p.Version == pin {
+				return p, nil
+			}
+		}
+
+		return nil, fmt.Errorf(
+			"app %s: version %q is pinned but not available (have: %s)",
+			tuple, pin, pluginVersionList(plugins))
+	}
+
+	best, tied, err := bestPluginVersion(tuple, plugins)
+	if err != nil {
+		return nil, err
+	}
+	if len(tied) <= 1 {
+		return best, nil
+	}
+
+	if m.AppSelector != nil {
+		p, err := m.AppSelector(tuple, tied)
+		if err != nil {
+			return nil, fmt.Errorf("app %s: %s", tuple, err)
+		}
+
+		return p, nil
+	}
+
+	colliding := qualify(tuple, tied)
+	sources := make([]string, len(colliding))
+	for i, qt := range colliding {
+		sources[i] = qt.Source
+	}
+
+	return nil, fmt.Errorf(
+		"app %s: claimed by %d plugins at version %s: %s",
+		tuple, len(colliding), best.Version, strings.Join(sources, ", "))
+}
+
+// qualify namespaces each of plugins' claim to tuple by its Source.
+func qualify(tuple app.Tuple, plugins []*Plugin) []QualifiedTuple {
+	result := make([]QualifiedTuple, len(plugins))
+	for i, p := range plugins {
+		result[i] = QualifiedTuple{Tuple: tuple, Source: p.Source()}
+	}
+
+	return result
+}
+
+// bestPluginVersion returns the highest semantic version among plugins,
+// along with every plugin that ties for that version (len(tied) > 1
+// means an unresolved collision).
+func bestPluginVersion(tuple app.Tuple, plugins []*Plugin) (*Plugin, []*Plugin, error) {
+	best := plugins[0]
+	bestVersion, err := version.NewVersion(comparablePluginVersion(best.Version))
+	if err != nil {
+		return nil, nil, fmt.Errorf(
+			"app %s: plugin %s has invalid version %q: %s",
+			tuple, best.Path, best.Version, err)
+	}
+
+	tied := []*Plugin{best}
+	for _, p := range plugins[1:] {
+		v, err := version.NewVersion(comparablePluginVersion(p.Version))
+		if err != nil {
+			return nil, nil, fmt.Errorf(
+				"app %s: plugin %s has invalid version %q: %s",
+				tuple, p.Path, p.Version, err)
+		}
+
+		switch {
+		case v.GreaterThan(bestVersion):
+			best, bestVersion = p, v
+			tied = []*Plugin{p}
+		case v.Equal(bestVersion):
+			tied = append(tied, p)
+		}
+	}
+
+	return best, tied, nil
+}
+
+// ResolveTuple returns every loaded plugin that claims to implement
+// tuple, so a caller like `otto compile` can present an ambiguity to the
+// user instead of silently binding the wrong implementation.
+func (m *PluginManager) ResolveTuple(tuple app.Tuple) ([]*Plugin, error) {
+	var result []*Plugin
+	for _, p := range m.Plugins() {
+		for _, candidate := range p.AppMeta.Tuples {
+			if candidate == tuple {
+				result = append(result, p)
+				break
+			}
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no plugin found for app %s", tuple)
+	}
+
+	return result, nil
+}
+
+// comparablePluginVersion maps BuiltinPluginVersion to a version that
+// sorts below any real release, so that an external plugin always wins
+// over the builtin of the same app tuple unless pinned otherwise.
+func comparablePluginVersion(v string) string {
+	if v == "" || v == BuiltinPluginVersion {
+		return "0.0.0"
+	}
+
+	return v
+}
+
+// pluginVersionList formats the versions of plugins for use in error
+// messages.
+func pluginVersionList(plugins []*Plugin) string {
+	versions := make([]string, len(plugins))
+	for i, p := range plugins {
+		versions[i] = p.Version
+	}
+
+	return fmt.Sprintf("%v", versions)
 }
 
 // Plugins returns the loaded plugins.
@@ -152,11 +565,30 @@ func (m *PluginManager) Plugins() []*Plugin {
 	return m.plugins
 }
 
+// pluginInfoTimeout bounds how long Discover will wait on a single
+// candidate binary to answer the "plugin-info" subcommand before giving
+// up on it, so one hung plugin can't stall discovery of the rest.
+const pluginInfoTimeout = 10 * time.Second
+
 // Discover will find all the available plugin binaries. Each time this
 // is called it will override any previously discovered plugins.
 func (m *PluginManager) Discover() error {
-	result := make([]*Plugin, 0, 20)
+	return m.DiscoverContext(context.Background())
+}
 
+// DiscoverContext is Discover with a caller-supplied context, letting
+// `otto` cancel a slow discovery (for example, a hung plugin binary)
+// with a deadline instead of blocking indefinitely.
+//
+// Builtins, PluginDirs matches, and catalog-registered external
+// binaries are merged in that order, keyed by (tuple, version): if the
+// same tuple at the same version is claimed by more than one of these
+// sources (for example, a plugin that lives in a watched PluginDirs
+// directory and also happens to be Register()ed in the catalog), the
+// later source wins outright instead of both surviving to trip the
+// ConfigureCore collision check.
+func (m *PluginManager) DiscoverContext(ctx context.Context) error {
+	var builtins []*Plugin
 	if !testingMode {
 		// Get our own path
 		exePath, err := osext.Executable()
@@ -165,14 +597,66 @@ func (m *PluginManager) Discover() error {
 		}
 
 		// First we add all the builtin plugins which we get by executing ourself
-		for k, _ := range m.PluginMap {
-			result = append(result, &Plugin{
+		for k := range m.PluginMap {
+			builtins = append(builtins, &Plugin{
 				Path: exePath,
 				Args: []string{"plugin-builtin", k},
 			})
 		}
 	}
 
+	// Walk PluginDirs for external plugin binaries.
+	paths, err := m.globPluginDirs()
+	if err != nil {
+		return err
+	}
+
+	dirCandidates := make([]*Plugin, len(paths))
+	for i, path := range paths {
+		dirCandidates[i] = &Plugin{Path: path}
+	}
+
+	// Probing learns each candidate's Tuples and Version so the merge
+	// below can key on (tuple, version). For PluginDirs candidates, a
+	// probe failure means "this isn't a valid Otto plugin" (wrong
+	// binary, stale file, one built before plugin-info existed) and is
+	// skipped rather than aborting discovery. Builtins are different: a
+	// builtin is by definition a valid plugin, so a probe failure there
+	// means self-exec itself is broken, and must fail discovery loudly
+	// instead of silently dropping a compiled-in app type out of
+	// core.Apps with no error at all.
+	probedBuiltins, err := probeRequired(ctx, builtins)
+	if err != nil {
+		return err
+	}
+	probedDirs := probeAll(ctx, dirCandidates)
+
+	m.catalogMu.RLock()
+	catalog, err := m.readCatalog()
+	m.catalogMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	catalogPlugins := make([]*Plugin, len(catalog.Entries))
+	for i, e := range catalog.Entries {
+		catalogPlugins[i] = &Plugin{
+			Path:    e.Path,
+			Version: e.Version,
+			Ref:     e.Ref,
+			AppMeta: &app.Meta{Tuples: e.Tuples},
+		}
+	}
+
+	result := mergeByTupleVersion(probedBuiltins, probedDirs, catalogPlugins)
+
+	if m.Resolver != nil {
+		for _, p := range result {
+			if p.Resolver == nil {
+				p.Resolver = m.Resolver
+			}
+		}
+	}
+
 	// Log it
 	for _, r := range result {
 		log.Printf("[DEBUG] Detected plugin: %s", r)
@@ -184,6 +668,169 @@ func (m *PluginManager) Discover() error {
 	return nil
 }
 
+// tupleVersionKey identifies a single (app tuple, version) claim, the
+// unit that later discovery sources are allowed to override earlier
+// ones at.
+type tupleVersionKey struct {
+	Tuple   app.Tuple
+	Version string
+}
+
+// mergeByTupleVersion flattens groups (each already probed, so every
+// Plugin's AppMeta.Tuples and Version are known) into a single plugin
+// list. Groups are merged in order: when two plugins across groups
+// claim the same (tuple, version), the one from the later group wins.
+func mergeByTupleVersion(groups ...[]*Plugin) []*Plugin {
+	winners := make(map[tupleVersionKey]*Plugin)
+	for _, group := range groups {
+		for _, p := range group {
+			if p.AppMeta == nil {
+				continue
+			}
+
+			for _, tuple := range p.AppMeta.Tuples {
+				winners[tupleVersionKey{Tuple: tuple, Version: p.Version}] = p
+			}
+		}
+	}
+
+	seen := make(map[*Plugin]bool)
+	result := make([]*Plugin, 0, len(winners))
+	for _, p := range winners {
+		if !seen[p] {
+			seen[p] = true
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
+
+// globPluginDirs returns every path in PluginDirs matching PluginGlob. A
+// failure to glob a directory itself (it doesn't exist, permissions,
+// etc.) is a real configuration error and is returned; it's the
+// per-candidate binaries matched by the glob that get to fail safely,
+// in probeAll.
+func (m *PluginManager) globPluginDirs() ([]string, error) {
+	var paths []string
+	for _, dir := range m.PluginDirs {
+		matches, err := filepath.Glob(filepath.Join(dir, PluginGlob))
+		if err != nil {
+			return nil, fmt.Errorf("Error globbing plugin dir %s: %s", dir, err)
+		}
+
+		paths = append(paths, matches...)
+	}
+
+	return paths, nil
+}
+
+// probeAll probes each candidate concurrently, bounded by a semaphore
+// sized to runtime.NumCPU() (the same pattern LoadAll and StoreUsed
+// use), via its "plugin-info" subcommand. A candidate that doesn't
+// answer plugin-info -- the wrong binary, a stale non-executable file
+// that happens to match PluginGlob, a permission error, or simply a
+// plugin built before plugin-info support existed -- is logged and
+// skipped rather than failing discovery for every other candidate.
+func probeAll(ctx context.Context, candidates []*Plugin) []*Plugin {
+	found := make([]*Plugin, len(candidates))
+	var wg sync.WaitGroup
+	sema := semaphore.New(runtime.NumCPU())
+	for i, c := range candidates {
+		wg.Add(1)
+		go func(i int, c *Plugin) {
+			defer wg.Done()
+
+			sema.Acquire()
+			defer sema.Release()
+
+			p, err := probePluginInfo(ctx, c.Path, c.Args...)
+			if err != nil {
+				log.Printf("[WARN] Skipping plugin candidate %s: %s", c.Path, err)
+				return
+			}
+
+			found[i] = p
+		}(i, c)
+	}
+	wg.Wait()
+
+	result := found[:0]
+	for _, p := range found {
+		if p != nil {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
+
+// probeRequired is probeAll's counterpart for candidates that must all
+// succeed: every candidate is probed concurrently, but unlike probeAll,
+// any single failure is aggregated into a multierror and returned as a
+// hard error instead of being logged and dropped.
+func probeRequired(ctx context.Context, candidates []*Plugin) ([]*Plugin, error) {
+	found := make([]*Plugin, len(candidates))
+	var merr *multierror.Error
+	var merrLock sync.Mutex
+	var wg sync.WaitGroup
+	sema := semaphore.New(runtime.NumCPU())
+	for i, c := range candidates {
+		wg.Add(1)
+		go func(i int, c *Plugin) {
+			defer wg.Done()
+
+			sema.Acquire()
+			defer sema.Release()
+
+			p, err := probePluginInfo(ctx, c.Path, c.Args...)
+			if err != nil {
+				merrLock.Lock()
+				defer merrLock.Unlock()
+				merr = multierror.Append(merr, fmt.Errorf(
+					"Error probing builtin plugin %v: %s", c.Args, err))
+				return
+			}
+
+			found[i] = p
+		}(i, c)
+	}
+	wg.Wait()
+
+	if err := merr.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// probePluginInfo execs path with args followed by the "plugin-info"
+// subcommand, a lightweight request/response that prints the plugin's
+// AppMeta as JSON to stdout, instead of opening
+// a full plugin.Client connection just to ask for this.
+func probePluginInfo(ctx context.Context, path string, args ...string) (*Plugin, error) {
+	ctx, cancel := context.WithTimeout(ctx, pluginInfoTimeout)
+	defer cancel()
+
+	cmdArgs := append(append([]string{}, args...), "plugin-info")
+	out, err := exec.CommandContext(ctx, path, cmdArgs...).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var meta app.Meta
+	if err := json.Unmarshal(out, &meta); err != nil {
+		return nil, fmt.Errorf("Error parsing plugin-info output: %s", err)
+	}
+
+	pluginVersion := meta.Version
+	if pluginVersion == "" {
+		pluginVersion = BuiltinPluginVersion
+	}
+
+	return &Plugin{Path: path, Args: args, Version: pluginVersion, AppMeta: &meta}, nil
+}
+
 // StoreUsed will persist the used plugins into a file. LoadUsed can
 // then be called to load the plugins that were used only, making plugin
 // loading much more efficient.
@@ -197,8 +844,8 @@ func (m *PluginManager) StoreUsed(path string) error {
 	}
 
 	// Calculate the MD5 hash of all used plugins. We do this one per CPU.
-	var err error
-	var errLock sync.Mutex
+	var merr *multierror.Error
+	var merrLock sync.Mutex
 	var wg sync.WaitGroup
 	sema := semaphore.New(runtime.NumCPU())
 	for _, p := range plugins {
@@ -209,16 +856,31 @@ func (m *PluginManager) StoreUsed(path string) error {
 			sema.Acquire()
 			defer sema.Release()
 
+			// A digest-ref plugin has no local file to hash; it's
+			// already content-addressed by its Path.
+			if strings.HasPrefix(p.Path, digestRefPrefix) {
+				p.Digest = p.Path
+				return
+			}
+
 			if err := p.CalcMD5(); err != nil {
-				errLock.Lock()
-				defer errLock.Unlock()
-				err = multierror.Append(err, fmt.Errorf(
+				merrLock.Lock()
+				defer merrLock.Unlock()
+				merr = multierror.Append(merr, fmt.Errorf(
 					"Error calculating MD5 of %s: %s", p.Path, err))
+				return
+			}
+
+			if err := p.CalcDigest(); err != nil {
+				merrLock.Lock()
+				defer merrLock.Unlock()
+				merr = multierror.Append(merr, fmt.Errorf(
+					"Error calculating digest of %s: %s", p.Path, err))
 			}
 		}(p)
 	}
 	wg.Wait()
-	if err != nil {
+	if err := merr.ErrorOrNil(); err != nil {
 		return err
 	}
 
@@ -261,10 +923,28 @@ func (m *PluginManager) LoadUsed(path string) error {
 	}
 
 	m.plugins = wrapper.Plugins
+	if m.Resolver != nil {
+		for _, p := range m.plugins {
+			if p.Resolver == nil {
+				p.Resolver = m.Resolver
+			}
+		}
+	}
+
 	return m.LoadAll()
 }
 
 // LoadAll will launch every plugin and add it to the CoreConfig given.
+//
+// For a plugin that already carries a Version (set by Discover's
+// probing, or restored from a used-plugins file by LoadUsed), LoadAll
+// also confirms that the binary it actually loads still reports that
+// same version, failing loudly rather than silently compiling against a
+// different version than whatever originally produced this environment.
+// This used to be a separate, fully serial pass over the same plugin set
+// (verifyUsedVersions) that ran immediately before LoadAll's own
+// concurrent pass below, doubling every plugin's process-spawn cost; the
+// check now piggybacks on the one Load this loop already does.
 func (m *PluginManager) LoadAll() error {
 	// If we've never loaded plugin paths, then let's discover those first
 	if m.Plugins() == nil {
@@ -286,12 +966,34 @@ func (m *PluginManager) LoadAll() error {
 			sema.Acquire()
 			defer sema.Release()
 
+			wantVersion := plugin.Version
+
 			if err := plugin.Load(); err != nil {
 				merrLock.Lock()
 				defer merrLock.Unlock()
 				merr = multierror.Append(merr, fmt.Errorf(
 					"Error loading plugin %s: %s",
 					plugin.Path, err))
+				return
+			}
+
+			if wantVersion != "" && plugin.Version != wantVersion {
+				merrLock.Lock()
+				defer merrLock.Unlock()
+				merr = multierror.Append(merr, fmt.Errorf(
+					"This environment was compiled with plugin %s at version\n"+
+						"%s, but the plugin found is version %s. This usually\n"+
+						"happens when the environment was compiled by a newer\n"+
+						"(or different) version of Otto. Refusing to silently\n"+
+						"downgrade; please use a matching Otto binary.",
+					plugin.Path, wantVersion, plugin.Version))
+				return
+			}
+
+			if err := m.EnsurePrivileges(plugin, m.GrantAllPermissions, m.PrivilegePrompt); err != nil {
+				merrLock.Lock()
+				defer merrLock.Unlock()
+				merr = multierror.Append(merr, err)
 			}
 		}(plugin)
 	}
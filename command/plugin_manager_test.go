@@ -0,0 +1,163 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/hashicorp/otto/app"
+)
+
+func TestBestPluginVersion(t *testing.T) {
+	tuple := app.Tuple{Type: "aws"}
+
+	v1 := &Plugin{Path: "v1", Version: "1.0.0"}
+	v2 := &Plugin{Path: "v2", Version: "2.0.0"}
+	v2dup := &Plugin{Path: "v2dup", Version: "2.0.0"}
+	builtin := &Plugin{Path: "builtin", Version: BuiltinPluginVersion}
+
+	t.Run("single highest version wins outright", func(t *testing.T) {
+		best, tied, err := bestPluginVersion(tuple, []*Plugin{v1, v2, builtin})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if best != v2 {
+			t.Fatalf("expected v2 to win, got %s", best.Path)
+		}
+		if len(tied) != 1 {
+			t.Fatalf("expected no tie, got %d", len(tied))
+		}
+	})
+
+	t.Run("exact version ties are reported", func(t *testing.T) {
+		best, tied, err := bestPluginVersion(tuple, []*Plugin{v1, v2, v2dup})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if best.Version != "2.0.0" {
+			t.Fatalf("expected 2.0.0 to win, got %s", best.Version)
+		}
+		if len(tied) != 2 {
+			t.Fatalf("expected 2 plugins tied, got %d", len(tied))
+		}
+	})
+
+	t.Run("builtin always loses to a real version", func(t *testing.T) {
+		best, tied, err := bestPluginVersion(tuple, []*Plugin{builtin, v1})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if best != v1 {
+			t.Fatalf("expected v1 to beat builtin, got %s", best.Path)
+		}
+		if len(tied) != 1 {
+			t.Fatalf("expected no tie, got %d", len(tied))
+		}
+	})
+
+	t.Run("invalid version is an error", func(t *testing.T) {
+		_, _, err := bestPluginVersion(tuple, []*Plugin{{Path: "bad", Version: "not-a-version"}})
+		if err == nil {
+			t.Fatal("expected error for invalid version")
+		}
+	})
+}
+
+func TestPluginManagerResolveTuple(t *testing.T) {
+	tuple := app.Tuple{Type: "aws"}
+	v1 := &Plugin{Path: "v1", Version: "1.0.0"}
+	v2 := &Plugin{Path: "v2", Version: "2.0.0"}
+	v2dup := &Plugin{Path: "v2dup", Version: "2.0.0"}
+
+	t.Run("highest version wins with no pin or collision", func(t *testing.T) {
+		m := &PluginManager{}
+		p, err := m.resolveTuple(tuple, []*Plugin{v1, v2})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if p != v2 {
+			t.Fatalf("expected v2, got %s", p.Path)
+		}
+	})
+
+	t.Run("pin selects an older version", func(t *testing.T) {
+		m := &PluginManager{PinnedVersions: map[app.Tuple]string{tuple: "1.0.0"}}
+		p, err := m.resolveTuple(tuple, []*Plugin{v1, v2})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if p != v1 {
+			t.Fatalf("expected pinned v1, got %s", p.Path)
+		}
+	})
+
+	t.Run("pin with no matching version is an error", func(t *testing.T) {
+		m := &PluginManager{PinnedVersions: map[app.Tuple]string{tuple: "9.9.9"}}
+		if _, err := m.resolveTuple(tuple, []*Plugin{v1, v2}); err == nil {
+			t.Fatal("expected error for unsatisfiable pin")
+		}
+	})
+
+	t.Run("unresolved collision is an error without an AppSelector", func(t *testing.T) {
+		m := &PluginManager{}
+		if _, err := m.resolveTuple(tuple, []*Plugin{v2, v2dup}); err == nil {
+			t.Fatal("expected collision error")
+		}
+	})
+
+	t.Run("AppSelector breaks a tie", func(t *testing.T) {
+		m := &PluginManager{
+			AppSelector: func(tuple app.Tuple, candidates []*Plugin) (*Plugin, error) {
+				return candidates[1], nil
+			},
+		}
+		p, err := m.resolveTuple(tuple, []*Plugin{v2, v2dup})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if p != v2dup {
+			t.Fatalf("expected AppSelector's choice v2dup, got %s", p.Path)
+		}
+	})
+}
+
+func TestMergeByTupleVersion(t *testing.T) {
+	tuple := app.Tuple{Type: "aws"}
+
+	builtin := &Plugin{Path: "builtin", Version: BuiltinPluginVersion, AppMeta: &app.Meta{Tuples: []app.Tuple{tuple}}}
+	dirPlugin := &Plugin{Path: "dir", Version: "1.0.0", AppMeta: &app.Meta{Tuples: []app.Tuple{tuple}}}
+	catalogOverride := &Plugin{Path: "catalog", Version: "1.0.0", AppMeta: &app.Meta{Tuples: []app.Tuple{tuple}}}
+	catalogNewVersion := &Plugin{Path: "catalog-new", Version: "2.0.0", AppMeta: &app.Meta{Tuples: []app.Tuple{tuple}}}
+
+	t.Run("later groups override earlier ones for the same (tuple, version)", func(t *testing.T) {
+		result := mergeByTupleVersion([]*Plugin{builtin}, []*Plugin{dirPlugin}, []*Plugin{catalogOverride})
+		if len(result) != 2 {
+			t.Fatalf("expected 2 winners (the builtin, and one for the (tuple, 1.0.0) claim), got %d", len(result))
+		}
+		foundOverride := false
+		for _, p := range result {
+			if p == dirPlugin {
+				t.Fatalf("expected the catalog entry to override the PluginDirs entry at 1.0.0")
+			}
+			if p == catalogOverride {
+				foundOverride = true
+			}
+		}
+		if !foundOverride {
+			t.Fatalf("expected the catalog entry to win the (tuple, 1.0.0) claim")
+		}
+	})
+
+	t.Run("distinct versions of the same tuple both survive", func(t *testing.T) {
+		result := mergeByTupleVersion([]*Plugin{builtin}, []*Plugin{dirPlugin}, []*Plugin{catalogNewVersion})
+		if len(result) != 3 {
+			t.Fatalf("expected 3 surviving plugins (one per version, builtin included), got %d", len(result))
+		}
+	})
+
+	t.Run("a plugin claiming no tuples (failed probe) is dropped", func(t *testing.T) {
+		unprobed := &Plugin{Path: "unprobed"}
+		result := mergeByTupleVersion([]*Plugin{unprobed})
+		if len(result) != 0 {
+			t.Fatalf("expected unprobed plugin to be dropped, got %d", len(result))
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Privilege kinds a plugin can declare it needs in its AppMeta,
+// borrowing the shape of Docker's plugin privileges model.
+const (
+	// PrivilegeNetwork allows the plugin to make outbound network
+	// connections.
+	PrivilegeNetwork = "network"
+
+	// PrivilegeFilesystem allows the plugin to read or write paths
+	// outside of the compile directory it's invoked in.
+	PrivilegeFilesystem = "filesystem"
+
+	// PrivilegeEnv allows the plugin to read host environment variables.
+	PrivilegeEnv = "env"
+
+	// PrivilegeExec allows the plugin to shell out to external binaries,
+	// such as terraform or vagrant.
+	PrivilegeExec = "exec"
+)
+
+// Privilege is a single host capability that a plugin has declared it
+// needs.
+type Privilege struct {
+	Kind        string
+	Description string
+}
+
+var privilegeDescriptions = map[string]string{
+	PrivilegeNetwork:    "make outbound network connections",
+	PrivilegeFilesystem: "read or write files outside the compile directory",
+	PrivilegeEnv:        "read host environment variables",
+	PrivilegeExec:       "shell out to external binaries (e.g. terraform, vagrant)",
+}
+
+// Privileges returns the privileges that p's AppMeta declares it needs.
+// p must already have been Load()ed.
+func (m *PluginManager) Privileges(p *Plugin) ([]Privilege, error) {
+	if p.AppMeta == nil {
+		return nil, fmt.Errorf("plugin %s has not been loaded", p.Path)
+	}
+
+	privileges := make([]Privilege, len(p.AppMeta.Privileges))
+	for i, kind := range p.AppMeta.Privileges {
+		desc, ok := privilegeDescriptions[kind]
+		if !ok {
+			desc = kind
+		}
+
+		privileges[i] = Privilege{Kind: kind, Description: desc}
+	}
+
+	return privileges, nil
+}
+
+// EnsurePrivileges makes sure the user has approved every privilege that
+// p declares it needs. If p was already granted exactly this set of
+// privileges on a previous run against the exact same binary (tracked
+// via GrantedPrivileges and GrantedDigest), this is a no-op. Otherwise,
+// unless grantAll is set, prompt is used to ask the user for interactive
+// y/N approval; a nil prompt falls back to reading from stdin.
+//
+// On every success path, p's factory is unlocked for use: see
+// Plugin.Load.
+func (m *PluginManager) EnsurePrivileges(p *Plugin, grantAll bool, prompt func(string) (bool, error)) error {
+	privileges, err := m.Privileges(p)
+	if err != nil {
+		return err
+	}
+	if len(privileges) == 0 {
+		p.privilegesGranted = true
+		return nil
+	}
+
+	requested := make([]string, len(privileges))
+	for i, priv := range privileges {
+		requested[i] = priv.Kind
+	}
+
+	digest, err := pluginIdentity(p)
+	if err != nil {
+		return err
+	}
+
+	if p.GrantedDigest == digest && stringSliceEqual(p.GrantedPrivileges, requested) {
+		p.privilegesGranted = true
+		return nil
+	}
+
+	if !grantAll {
+		var buf strings.Builder
+		fmt.Fprintf(&buf, "Plugin %s requests the following privileges:\n", p.Path)
+		for _, priv := range privileges {
+			fmt.Fprintf(&buf, "  * %s: %s\n", priv.Kind, priv.Description)
+		}
+		fmt.Fprint(&buf, "Grant these privileges? [y/N] ")
+
+		if prompt == nil {
+			prompt = promptStdin
+		}
+
+		ok, err := prompt(buf.String())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("privileges for plugin %s were not granted", p.Path)
+		}
+	}
+
+	p.GrantedPrivileges = requested
+	p.GrantedDigest = digest
+	p.privilegesGranted = true
+	return nil
+}
+
+// pluginIdentity returns the content digest that a privilege grant for p
+// should be pinned to: p.Digest if it's already been computed (or p.Path
+// itself, if p.Path is already a digest reference), or else computed on
+// demand so EnsurePrivileges doesn't depend on a caller having already
+// called CalcDigest.
+func pluginIdentity(p *Plugin) (string, error) {
+	if p.Digest != "" {
+		return p.Digest, nil
+	}
+	if strings.HasPrefix(p.Path, digestRefPrefix) {
+		return p.Path, nil
+	}
+
+	if err := p.CalcDigest(); err != nil {
+		return "", fmt.Errorf("Error calculating digest of %s: %s", p.Path, err)
+	}
+
+	return p.Digest, nil
+}
+
+// promptStdin is the default PrivilegePrompt: it prints message and
+// reads a y/N answer from stdin.
+func promptStdin(message string) (bool, error) {
+	fmt.Print(message)
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+
+	line = strings.ToLower(strings.TrimSpace(line))
+	return line == "y" || line == "yes", nil
+}
+
+func stringSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,114 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/hashicorp/otto/app"
+)
+
+func TestEnsurePrivilegesNoPrivilegesRequested(t *testing.T) {
+	m := &PluginManager{}
+	p := &Plugin{Path: "/bin/otto-noop", AppMeta: &app.Meta{}}
+
+	if err := m.EnsurePrivileges(p, false, failPrompt(t)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !p.privilegesGranted {
+		t.Fatal("expected privilegesGranted to be set even with zero requested privileges")
+	}
+}
+
+func TestEnsurePrivilegesGrantAll(t *testing.T) {
+	m := &PluginManager{}
+	p := &Plugin{
+		Path:    "/bin/otto-aws",
+		Digest:  "sha256:aaaa",
+		AppMeta: &app.Meta{Privileges: []string{PrivilegeNetwork}},
+	}
+
+	if err := m.EnsurePrivileges(p, true, failPrompt(t)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !p.privilegesGranted {
+		t.Fatal("expected privilegesGranted to be set")
+	}
+	if p.GrantedDigest != p.Digest {
+		t.Fatalf("expected GrantedDigest %s, got %s", p.Digest, p.GrantedDigest)
+	}
+	if !stringSliceEqual(p.GrantedPrivileges, []string{PrivilegeNetwork}) {
+		t.Fatalf("expected GrantedPrivileges to record %v, got %v", []string{PrivilegeNetwork}, p.GrantedPrivileges)
+	}
+}
+
+func TestEnsurePrivilegesPreviouslyGrantedSameDigestSkipsPrompt(t *testing.T) {
+	m := &PluginManager{}
+	p := &Plugin{
+		Path:              "/bin/otto-aws",
+		Digest:            "sha256:aaaa",
+		GrantedDigest:     "sha256:aaaa",
+		GrantedPrivileges: []string{PrivilegeNetwork},
+		AppMeta:           &app.Meta{Privileges: []string{PrivilegeNetwork}},
+	}
+
+	if err := m.EnsurePrivileges(p, false, failPrompt(t)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !p.privilegesGranted {
+		t.Fatal("expected privilegesGranted to be set")
+	}
+}
+
+func TestEnsurePrivilegesDigestChangeForcesRePrompt(t *testing.T) {
+	m := &PluginManager{}
+	p := &Plugin{
+		Path:              "/bin/otto-aws",
+		Digest:            "sha256:bbbb", // the binary at Path changed since the last grant
+		GrantedDigest:     "sha256:aaaa",
+		GrantedPrivileges: []string{PrivilegeNetwork},
+		AppMeta:           &app.Meta{Privileges: []string{PrivilegeNetwork}},
+	}
+
+	prompted := false
+	prompt := func(message string) (bool, error) {
+		prompted = true
+		return true, nil
+	}
+
+	if err := m.EnsurePrivileges(p, false, prompt); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !prompted {
+		t.Fatal("expected a swapped binary with the same privilege kinds to re-prompt")
+	}
+	if p.GrantedDigest != "sha256:bbbb" {
+		t.Fatalf("expected GrantedDigest to be updated to the new digest, got %s", p.GrantedDigest)
+	}
+}
+
+func TestEnsurePrivilegesDeclinedLeavesFactoryGated(t *testing.T) {
+	m := &PluginManager{}
+	p := &Plugin{
+		Path:    "/bin/otto-aws",
+		Digest:  "sha256:aaaa",
+		AppMeta: &app.Meta{Privileges: []string{PrivilegeNetwork}},
+	}
+
+	prompt := func(message string) (bool, error) { return false, nil }
+
+	if err := m.EnsurePrivileges(p, false, prompt); err == nil {
+		t.Fatal("expected an error when privileges are declined")
+	}
+	if p.privilegesGranted {
+		t.Fatal("expected privilegesGranted to remain false when privileges are declined")
+	}
+}
+
+// failPrompt returns a PrivilegePrompt that fails the test if it's ever
+// invoked, for assertions that a grant should be resolved without
+// prompting.
+func failPrompt(t *testing.T) func(string) (bool, error) {
+	return func(message string) (bool, error) {
+		t.Fatalf("prompt should not have been called, got message: %s", message)
+		return false, nil
+	}
+}
@@ -0,0 +1,165 @@
+package command
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/otto/command/pluginstore"
+)
+
+func TestResolveExecPathNonDigestPath(t *testing.T) {
+	p := &Plugin{Path: "/usr/local/bin/otto-aws"}
+	path, err := p.resolveExecPath()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if path != p.Path {
+		t.Fatalf("expected a non-digest Path to be returned unchanged, got %s", path)
+	}
+}
+
+func TestResolveExecPathMaterializesFromBlobstore(t *testing.T) {
+	defer setTestHome(t)()
+
+	blobstore, err := defaultBlobstore()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	content := []byte("#!/bin/sh\necho hi\n")
+	digest, err := blobstore.Put(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p := &Plugin{Path: digest.String()}
+	path, err := p.resolveExecPath()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(filepath.Dir(path))
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("expected materialized contents %q, got %q", content, got)
+	}
+}
+
+func TestResolveExecPathPullsOnMiss(t *testing.T) {
+	defer setTestHome(t)()
+
+	content := []byte("plugin binary")
+	digest := sha256Digest(content)
+
+	p := &Plugin{
+		Path:     digest.String(),
+		Ref:      "registry.otto.sh/hashicorp/aws:1.0.0",
+		Resolver: &fakeResolver{blobs: map[pluginstore.Digest][]byte{digest: content}},
+	}
+
+	path, err := p.resolveExecPath()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(filepath.Dir(path))
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("expected pulled contents %q, got %q", content, got)
+	}
+}
+
+func TestResolveExecPathMissingBlobNoResolverIsAnError(t *testing.T) {
+	defer setTestHome(t)()
+
+	p := &Plugin{Path: sha256Digest([]byte("never stored")).String()}
+	if _, err := p.resolveExecPath(); err == nil {
+		t.Fatal("expected an error when the blob is missing and no Resolver is configured")
+	}
+}
+
+func TestResolveExecPathPullWithWrongDigestIsRejected(t *testing.T) {
+	defer setTestHome(t)()
+
+	wantDigest := sha256Digest([]byte("expected content"))
+	p := &Plugin{
+		Path:     wantDigest.String(),
+		Ref:      "registry.otto.sh/hashicorp/aws:1.0.0",
+		Resolver: &fakeResolver{blobs: map[pluginstore.Digest][]byte{wantDigest: []byte("different content")}},
+	}
+
+	if _, err := p.resolveExecPath(); err == nil {
+		t.Fatal("expected an error when the pulled blob's digest doesn't match what was requested")
+	}
+}
+
+// setTestHome points $HOME at a fresh temp directory for the duration of
+// a test, so defaultBlobstore resolves to an empty, isolated blobstore.
+// The returned func restores the original $HOME and removes the temp
+// directory; call it via defer.
+func setTestHome(t *testing.T) func() {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "otto-home")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	prevHome, hadHome := os.LookupEnv("HOME")
+	os.Setenv("HOME", dir)
+
+	return func() {
+		if hadHome {
+			os.Setenv("HOME", prevHome)
+		} else {
+			os.Unsetenv("HOME")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func sha256Digest(data []byte) pluginstore.Digest {
+	sum := sha256.Sum256(data)
+	return pluginstore.Digest("sha256:" + hex.EncodeToString(sum[:]))
+}
+
+// fakeResolver is a minimal pluginstore.Resolver backed by an in-memory
+// map of digest to blob contents, standing in for a real registry in
+// tests.
+type fakeResolver struct {
+	blobs map[pluginstore.Digest][]byte
+}
+
+func (f *fakeResolver) Manifest(ref pluginstore.Ref) (*pluginstore.PluginManifest, error) {
+	return nil, fmt.Errorf("fakeResolver: Manifest not implemented")
+}
+
+func (f *fakeResolver) Blob(ref pluginstore.Ref, digest pluginstore.Digest) (io.ReadCloser, error) {
+	data, ok := f.blobs[digest]
+	if !ok {
+		return nil, fmt.Errorf("fakeResolver: no blob %s", digest)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (f *fakeResolver) PushManifest(ref pluginstore.Ref, manifest *pluginstore.PluginManifest) error {
+	return fmt.Errorf("fakeResolver: PushManifest not implemented")
+}
+
+func (f *fakeResolver) PushBlob(ref pluginstore.Ref, r io.Reader) (pluginstore.Digest, error) {
+	return "", fmt.Errorf("fakeResolver: PushBlob not implemented")
+}
@@ -0,0 +1,39 @@
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// signatureSuffix is appended to a Plugin's Path to find its detached
+// signature, following the `gpg --detach-sign --armor` convention.
+const signatureSuffix = ".asc"
+
+// VerifySignature checks the detached PGP signature for p (expected
+// alongside the binary at Path+".asc") against keyring. Operators can
+// call this before EnsurePrivileges to require that a plugin's binary
+// was signed by a trusted key before its requested privileges are ever
+// granted.
+func (m *PluginManager) VerifySignature(p *Plugin, keyring openpgp.KeyRing) error {
+	sigPath := p.Path + signatureSuffix
+
+	sigFile, err := os.Open(sigPath)
+	if err != nil {
+		return fmt.Errorf("Error opening signature for plugin %s: %s", p.Path, err)
+	}
+	defer sigFile.Close()
+
+	binFile, err := os.Open(p.Path)
+	if err != nil {
+		return err
+	}
+	defer binFile.Close()
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, binFile, sigFile); err != nil {
+		return fmt.Errorf("Error verifying signature of plugin %s: %s", p.Path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+// Package pluginstore turns Otto plugins into content-addressable
+// artifacts that can be pushed to and pulled from any registry that
+// speaks the OCI distribution API, the same way Docker's plugin v2
+// system distributes plugins.
+package pluginstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Digest is a sha256 content digest in "sha256:<hex>" form.
+type Digest string
+
+// String returns the digest in "sha256:<hex>" form.
+func (d Digest) String() string {
+	return string(d)
+}
+
+// Hex returns just the hex-encoded hash, with the "sha256:" prefix
+// stripped, for use as a path component.
+func (d Digest) Hex() string {
+	const prefix = "sha256:"
+	if len(d) > len(prefix) && string(d)[:len(prefix)] == prefix {
+		return string(d)[len(prefix):]
+	}
+
+	return string(d)
+}
+
+// Blobstore is a local, content-addressable store of plugin blobs
+// (binaries, manifests, and layers), rooted at a directory such as
+// "~/.otto.d/plugins/blobs".
+type Blobstore struct {
+	// Dir is the root directory of the blobstore. Blobs are stored at
+	// Dir/sha256/<hex digest>.
+	Dir string
+}
+
+// Put copies r into the blobstore, returning the sha256 digest of its
+// contents. The blob is written to a temporary file and renamed into
+// place so that concurrent readers never observe a partial blob.
+func (b *Blobstore) Put(r io.Reader) (Digest, error) {
+	dir := filepath.Join(b.Dir, "sha256")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	tf, err := ioutil.TempFile(dir, "blob-")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tf.Name()
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	hash := sha256.New()
+	if _, err := io.Copy(tf, io.TeeReader(r, hash)); err != nil {
+		tf.Close()
+		return "", err
+	}
+	if err := tf.Close(); err != nil {
+		return "", err
+	}
+
+	digest := Digest(fmt.Sprintf("sha256:%s", hex.EncodeToString(hash.Sum(nil))))
+	if err := os.Rename(tmpPath, b.path(digest)); err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// Get opens the blob with the given digest for reading. The caller must
+// close the returned ReadCloser.
+func (b *Blobstore) Get(digest Digest) (io.ReadCloser, error) {
+	return os.Open(b.path(digest))
+}
+
+// Has returns whether the blobstore already contains digest, so callers
+// can skip re-pulling a blob they already have.
+func (b *Blobstore) Has(digest Digest) bool {
+	_, err := os.Stat(b.path(digest))
+	return err == nil
+}
+
+func (b *Blobstore) path(digest Digest) string {
+	return filepath.Join(b.Dir, "sha256", digest.Hex())
+}
+
+// digestOf returns the sha256 digest of data without touching disk, for
+// callers (like a registry push) that already hold the blob in memory.
+func digestOf(data []byte) Digest {
+	hash := sha256.Sum256(data)
+	return Digest(fmt.Sprintf("sha256:%s", hex.EncodeToString(hash[:])))
+}
@@ -0,0 +1,70 @@
+package pluginstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBlobstorePutGetHas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otto-blobstore")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &Blobstore{Dir: dir}
+	content := []byte("plugin binary contents")
+
+	digest, err := b.Put(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	want := digestOf(content)
+	if digest != want {
+		t.Fatalf("expected digest %s, got %s", want, digest)
+	}
+
+	if !b.Has(digest) {
+		t.Fatal("expected Has to report the blob as present")
+	}
+	if b.Has(Digest("sha256:0000000000000000000000000000000000000000000000000000000000000000")) {
+		t.Fatal("expected Has to report a nonexistent digest as absent")
+	}
+
+	rc, err := b.Get(digest)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer rc.Close()
+
+	got, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("expected %q, got %q", content, got)
+	}
+}
+
+func TestBlobstoreGetMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "otto-blobstore")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &Blobstore{Dir: dir}
+	if _, err := b.Get(Digest("sha256:missing")); err == nil {
+		t.Fatal("expected an error fetching a blob that was never stored")
+	}
+}
+
+func TestDigestHex(t *testing.T) {
+	d := Digest("sha256:abc123")
+	if d.Hex() != "abc123" {
+		t.Fatalf("expected abc123, got %s", d.Hex())
+	}
+}
@@ -0,0 +1,41 @@
+package pluginstore
+
+import (
+	"github.com/hashicorp/otto/app"
+)
+
+// ManifestMediaType is the media type recorded on a PluginManifest so
+// that registries and future Otto versions can distinguish it from
+// other OCI artifacts.
+const ManifestMediaType = "application/vnd.otto.plugin.manifest.v1+json"
+
+// PluginManifest describes a single plugin as a content-addressable
+// artifact: a config blob plus an ordered list of layers (today, always
+// exactly one layer: the plugin binary itself).
+type PluginManifest struct {
+	MediaType string `json:"mediaType"`
+
+	// Config is the digest of the JSON-encoded PluginConfig blob.
+	Config Digest `json:"config"`
+
+	// Layers are the digests of the blobs that make up the plugin,
+	// applied in order. For Otto plugins this is just the binary.
+	Layers []Digest `json:"layers"`
+
+	// Version is the semantic version of the plugin this manifest
+	// describes, matching Plugin.Version in the command package.
+	Version string `json:"version"`
+}
+
+// PluginConfig is the blob referenced by PluginManifest.Config. It
+// carries the metadata that used to only be available by executing the
+// plugin binary, so a registry (and `otto plugin install`) can inspect
+// a plugin without running it.
+type PluginConfig struct {
+	// Tuples are the app tuples this plugin provides.
+	Tuples []app.Tuple `json:"tuples"`
+
+	// Privileges are the host privileges this plugin will request on
+	// load, as declared by the plugin author.
+	Privileges []string `json:"privileges,omitempty"`
+}
@@ -0,0 +1,282 @@
+package pluginstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Ref identifies a plugin artifact in a registry, e.g.
+// "registry.otto.sh/hashicorp/aws:1.2.0".
+type Ref struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+func (r Ref) String() string {
+	return fmt.Sprintf("%s/%s:%s", r.Registry, r.Repository, r.Tag)
+}
+
+// ParseRef parses a plugin ref of the form "registry/repository:tag"
+// (e.g. "registry.otto.sh/hashicorp/aws:1.2.0") as produced by `otto
+// plugin install`/`otto plugin push`. Repository may itself contain
+// slashes; Registry is always the first path component and Tag is
+// everything after the last colon.
+func ParseRef(s string) (Ref, error) {
+	slash := strings.Index(s, "/")
+	if slash < 0 {
+		return Ref{}, fmt.Errorf("plugin ref %q must be of the form registry/repository:tag", s)
+	}
+
+	registry := s[:slash]
+	rest := s[slash+1:]
+
+	colon := strings.LastIndex(rest, ":")
+	if colon < 0 {
+		return Ref{}, fmt.Errorf("plugin ref %q must include a :tag", s)
+	}
+
+	repository := rest[:colon]
+	tag := rest[colon+1:]
+	if registry == "" || repository == "" || tag == "" {
+		return Ref{}, fmt.Errorf("plugin ref %q must be of the form registry/repository:tag", s)
+	}
+
+	return Ref{Registry: registry, Repository: repository, Tag: tag}, nil
+}
+
+// Resolver fetches and publishes plugin manifests and blobs against a
+// registry. The OCI distribution API implementation is the only one
+// Otto ships today, but it's an interface so a future local or
+// filesystem-backed resolver can be swapped in for testing.
+type Resolver interface {
+	// Manifest fetches and decodes the manifest for ref.
+	Manifest(ref Ref) (*PluginManifest, error)
+
+	// Blob returns a reader over the blob with the given digest. The
+	// caller must close it.
+	Blob(ref Ref, digest Digest) (io.ReadCloser, error)
+
+	// PushManifest uploads manifest for ref. All of the blobs it
+	// references must already have been pushed with PushBlob.
+	PushManifest(ref Ref, manifest *PluginManifest) error
+
+	// PushBlob uploads the contents of r as a blob, returning its
+	// digest. Implementations should skip the upload if the registry
+	// already has a blob of that digest (content addressability).
+	PushBlob(ref Ref, r io.Reader) (Digest, error)
+}
+
+// OCIResolver is a Resolver backed by any registry implementing the OCI
+// distribution spec (the same API Docker registries and most container
+// registries speak), authenticating with a bearer token.
+type OCIResolver struct {
+	// Client is the HTTP client used for all registry requests. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+
+	// Token, if set, is sent as "Authorization: Bearer <Token>" on
+	// every request. TokenSource can be used instead to fetch (and
+	// refresh) a token lazily.
+	Token string
+
+	// TokenSource, if set, is called before each request that hasn't
+	// already been given an explicit Token.
+	TokenSource func(ref Ref) (string, error)
+}
+
+func (o *OCIResolver) client() *http.Client {
+	if o.Client != nil {
+		return o.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (o *OCIResolver) authToken(ref Ref) (string, error) {
+	if o.Token != "" {
+		return o.Token, nil
+	}
+	if o.TokenSource != nil {
+		return o.TokenSource(ref)
+	}
+
+	return "", nil
+}
+
+func (o *OCIResolver) do(req *http.Request, ref Ref) (*http.Response, error) {
+	token, err := o.authToken(ref)
+	if err != nil {
+		return nil, fmt.Errorf("Error obtaining registry token: %s", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return o.client().Do(req)
+}
+
+// Manifest implements Resolver.
+func (o *OCIResolver) Manifest(ref Ref) (*PluginManifest, error) {
+	url := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.Registry, ref.Repository, ref.Tag)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ManifestMediaType)
+
+	resp, err := o.do(req, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry returned %s fetching manifest for %s", resp.Status, ref)
+	}
+
+	var manifest PluginManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("Error decoding manifest for %s: %s", ref, err)
+	}
+
+	return &manifest, nil
+}
+
+// Blob implements Resolver.
+func (o *OCIResolver) Blob(ref Ref, digest Digest) (io.ReadCloser, error) {
+	url := fmt.Sprintf("https://%s/v2/%s/blobs/%s", ref.Registry, ref.Repository, digest)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.do(req, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("registry returned %s fetching blob %s", resp.Status, digest)
+	}
+
+	return resp.Body, nil
+}
+
+// PushManifest implements Resolver.
+func (o *OCIResolver) PushManifest(ref Ref, manifest *PluginManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.Registry, ref.Repository, ref.Tag)
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ManifestMediaType)
+
+	resp, err := o.do(req, ref)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("registry returned %s pushing manifest for %s", resp.Status, ref)
+	}
+
+	return nil
+}
+
+// PushBlob implements Resolver.
+//
+// This uses the single-request "monolithic upload" form of the OCI
+// distribution API: POST to start the upload, then PUT the body with
+// the digest we computed locally. A HEAD request for that digest is made
+// first, and the upload is skipped if the registry answers 200 OK.
+func (o *OCIResolver) PushBlob(ref Ref, r io.Reader) (Digest, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	digest := digestOf(data)
+
+	headURL := fmt.Sprintf("https://%s/v2/%s/blobs/%s", ref.Registry, ref.Repository, digest)
+	headReq, err := http.NewRequest("HEAD", headURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if headResp, err := o.do(headReq, ref); err == nil {
+		headResp.Body.Close()
+		if headResp.StatusCode == http.StatusOK {
+			return digest, nil
+		}
+	}
+
+	startURL := fmt.Sprintf("https://%s/v2/%s/blobs/uploads/", ref.Registry, ref.Repository)
+	req, err := http.NewRequest("POST", startURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := o.do(req, ref)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return "", fmt.Errorf("registry returned %s starting blob upload", resp.Status)
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("registry did not return an upload location")
+	}
+
+	// Location is implementation-defined by the OCI distribution spec: it
+	// may be relative to startURL or absolute, and it may or may not
+	// already carry a query string. Resolve and add "digest" properly
+	// via net/url instead of assuming either.
+	base, err := url.Parse(startURL)
+	if err != nil {
+		return "", err
+	}
+	loc, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("registry returned an invalid upload location %q: %s", location, err)
+	}
+	putURL := base.ResolveReference(loc)
+
+	q := putURL.Query()
+	q.Set("digest", string(digest))
+	putURL.RawQuery = q.Encode()
+
+	putReq, err := http.NewRequest("PUT", putURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	putReq.Header.Set("Content-Type", "application/octet-stream")
+
+	putResp, err := o.do(putReq, ref)
+	if err != nil {
+		return "", err
+	}
+	defer putResp.Body.Close()
+
+	if putResp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("registry returned %s completing blob upload", putResp.Status)
+	}
+
+	return digest, nil
+}
@@ -0,0 +1,171 @@
+package pluginstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeOCIRegistry is a minimal OCI distribution API server: enough of
+// manifest GET/PUT and blob GET/POST/PUT to exercise OCIResolver end to
+// end, including a bare-path (no query string) Location header on the
+// upload-start response, the case that previously produced a malformed
+// PUT URL.
+func fakeOCIRegistry(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	manifests := map[string][]byte{}
+	blobs := map[string][]byte{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/hashicorp/aws/manifests/1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := manifests["1.0.0"]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case http.MethodPut:
+			data, _ := ioutil.ReadAll(r.Body)
+			manifests["1.0.0"] = data
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	// The upload-start POST and the completing PUT (to the Location
+	// returned by the POST) both land under blobs/uploads/.
+	mux.HandleFunc("/v2/hashicorp/aws/blobs/uploads/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			// No query string in Location: this is the scenario that a
+			// string-concatenated "&digest=" would have mangled.
+			w.Header().Set("Location", "/v2/hashicorp/aws/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodPut:
+			digest := r.URL.Query().Get("digest")
+			if digest == "" {
+				// This is exactly the failure mode a malformed PUT URL
+				// produces: the query parameter never arrives.
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(r.Body)
+			blobs[digest] = data
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/v2/hashicorp/aws/blobs/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			digest := strings.TrimPrefix(r.URL.Path, "/v2/hashicorp/aws/blobs/")
+			data, ok := blobs[digest]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestOCIResolverPushAndPullRoundTrip(t *testing.T) {
+	server := fakeOCIRegistry(t)
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+	ref := Ref{Registry: registry, Repository: "hashicorp/aws", Tag: "1.0.0"}
+
+	// OCIResolver always dials https://; point it at our http:// test
+	// server instead via a custom client transport that rewrites the
+	// scheme, since httptest.Server only serves plain HTTP.
+	resolver := &OCIResolver{Client: httpTestClient(server)}
+
+	binary := []byte("plugin binary contents")
+	binaryDigest, err := resolver.PushBlob(ref, bytes.NewReader(binary))
+	if err != nil {
+		t.Fatalf("PushBlob(binary): %s", err)
+	}
+
+	config := []byte(`{"tuples":[{"type":"aws"}]}`)
+	configDigest, err := resolver.PushBlob(ref, bytes.NewReader(config))
+	if err != nil {
+		t.Fatalf("PushBlob(config): %s", err)
+	}
+
+	manifest := &PluginManifest{
+		MediaType: ManifestMediaType,
+		Config:    configDigest,
+		Layers:    []Digest{binaryDigest},
+		Version:   "1.0.0",
+	}
+	if err := resolver.PushManifest(ref, manifest); err != nil {
+		t.Fatalf("PushManifest: %s", err)
+	}
+
+	gotManifest, err := resolver.Manifest(ref)
+	if err != nil {
+		t.Fatalf("Manifest: %s", err)
+	}
+	if gotManifest.Version != manifest.Version || gotManifest.Config != manifest.Config {
+		t.Fatalf("expected manifest %+v, got %+v", manifest, gotManifest)
+	}
+
+	rc, err := resolver.Blob(ref, binaryDigest)
+	if err != nil {
+		t.Fatalf("Blob: %s", err)
+	}
+	defer rc.Close()
+
+	got, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(got, binary) {
+		t.Fatalf("expected %q, got %q", binary, got)
+	}
+}
+
+// httpTestClient returns an *http.Client that transparently rewrites
+// https requests to http and routes them at server, so OCIResolver's
+// hardcoded "https://" URLs can be exercised against httptest.Server.
+func httpTestClient(server *httptest.Server) *http.Client {
+	return &http.Client{
+		Transport: &rewriteSchemeTransport{base: server.Client().Transport, serverURL: server.URL},
+	}
+}
+
+type rewriteSchemeTransport struct {
+	base      http.RoundTripper
+	serverURL string
+}
+
+func (t *rewriteSchemeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	serverURL, err := url.Parse(t.serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req.URL.Scheme = serverURL.Scheme
+	req.URL.Host = serverURL.Host
+	req.Host = serverURL.Host
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return base.RoundTrip(req)
+}
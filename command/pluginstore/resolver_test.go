@@ -0,0 +1,49 @@
+package pluginstore
+
+import "testing"
+
+func TestParseRef(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    Ref
+		wantErr bool
+	}{
+		{
+			in:   "registry.otto.sh/hashicorp/aws:1.2.0",
+			want: Ref{Registry: "registry.otto.sh", Repository: "hashicorp/aws", Tag: "1.2.0"},
+		},
+		{
+			in:   "localhost:5000/aws:latest",
+			want: Ref{Registry: "localhost:5000", Repository: "aws", Tag: "latest"},
+		},
+		{in: "missing-a-slash:1.0.0", wantErr: true},
+		{in: "registry.otto.sh/no-tag", wantErr: true},
+		{in: "/aws:1.0.0", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		got, err := ParseRef(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseRef(%q): expected an error, got %+v", tc.in, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseRef(%q): unexpected error: %s", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseRef(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRefString(t *testing.T) {
+	ref := Ref{Registry: "registry.otto.sh", Repository: "hashicorp/aws", Tag: "1.2.0"}
+	want := "registry.otto.sh/hashicorp/aws:1.2.0"
+	if ref.String() != want {
+		t.Fatalf("expected %q, got %q", want, ref.String())
+	}
+}